@@ -0,0 +1,215 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigRule is the on-disk schema for a testify -> grailbio/testutil
+// rewrite rule, loaded either from the built-in defaultRulesYAML or from a
+// user-supplied -rules=path.yaml file. It generalizes the template-based
+// substitution table the tool used before the native engine existed, so a
+// new mapping (or a mapping to a different assertion library entirely) can
+// be added without recompiling untestify.
+type ConfigRule struct {
+	// Signature documents the rule's fixed parameters, e.g.
+	// "a, b interface{}". It's informational only; Before's argument
+	// list is what the engine actually binds.
+	Signature string `yaml:"signature"`
+	// Aliases are additional testify function names Before's call also
+	// matches, e.g. "Equalf" alongside "Equal" - see Rule.Aliases.
+	Aliases []string `yaml:"aliases"`
+	// Before is a single call expression recognizing the testify call to
+	// translate, e.g. "assert.Equal(t, a, b ARGS)". Its first argument
+	// names the testing.TB in scope; the rest are the fixed parameters
+	// described by Signature; the literal trailing word ARGS, if
+	// present, stands for the call's msgAndArgs.
+	Before string `yaml:"before"`
+	// After is the replacement call expression, e.g.
+	// "YY.EQ(t, b, a ARGS)". YY is filled in with the target package
+	// (gexpect or gassert) by the engine; any other identifier matching
+	// one of Before's parameters is substituted with the matched call's
+	// actual argument (within the expression forms substTemplate walks).
+	After string `yaml:"after"`
+	// Imports lists additional import paths After's output references.
+	Imports []string `yaml:"imports"`
+	// HelperImports is imports for the github.com/grailbio/testutil/h
+	// matcher package specifically. It's a separate field purely so a
+	// rules file can spell out "this rule needs the h matchers" without
+	// burying it in a generic imports list.
+	HelperImports []string `yaml:"helper_imports"`
+}
+
+// LoadRulesFile reads and parses a -rules YAML file.
+func LoadRulesFile(path string) ([]ConfigRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseRulesYAML(data)
+}
+
+func parseRulesYAML(data []byte) ([]ConfigRule, error) {
+	var crs []ConfigRule
+	if err := yaml.Unmarshal(data, &crs); err != nil {
+		return nil, err
+	}
+	return crs, nil
+}
+
+// DefaultRules parses and compiles the rules untestify has always shipped;
+// passing no -rules flag behaves exactly as if this were the rules file.
+func DefaultRules() ([]Rule, error) {
+	crs, err := parseRulesYAML([]byte(defaultRulesYAML))
+	if err != nil {
+		return nil, err
+	}
+	return CompileRules(crs)
+}
+
+// CompileRules compiles a list of ConfigRules into Rules the engine can
+// apply.
+func CompileRules(crs []ConfigRule) ([]Rule, error) {
+	rules := make([]Rule, 0, len(crs))
+	for _, cr := range crs {
+		rule, err := CompileRule(cr)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// CompileRule turns one ConfigRule into a Rule by parsing its before/after
+// templates as Go expressions.
+func CompileRule(cr ConfigRule) (Rule, error) {
+	beforeCall, err := parseTemplateCall(cr.Before)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: before: %v", cr.Before, err)
+	}
+	beforeSel, ok := beforeCall.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return Rule{}, fmt.Errorf("rule %q: before must be of the form pkg.Func(...)", cr.Before)
+	}
+	if len(beforeCall.Args) == 0 {
+		return Rule{}, fmt.Errorf("rule %q: before has no arguments, want at least the testing.TB", cr.Before)
+	}
+	tName, ok := beforeCall.Args[0].(*ast.Ident)
+	if !ok {
+		return Rule{}, fmt.Errorf("rule %q: before's first argument must be a plain identifier", cr.Before)
+	}
+	params := make([]string, 0, len(beforeCall.Args)-1)
+	for _, arg := range beforeCall.Args[1:] {
+		id, ok := arg.(*ast.Ident)
+		if !ok {
+			return Rule{}, fmt.Errorf("rule %q: before's arguments must be plain identifiers", cr.Before)
+		}
+		params = append(params, id.Name)
+	}
+
+	afterCall, err := parseTemplateCall(cr.After)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: after: %v", cr.After, err)
+	}
+
+	build := func(pkgIdent string, t ast.Expr, args, msgAndArgs []ast.Expr, ellipsis bool) ast.Expr {
+		bindings := make(map[string]ast.Expr, len(params)+1)
+		bindings[tName.Name] = t
+		for i, name := range params {
+			bindings[name] = args[i]
+		}
+		call := substTemplate(afterCall, bindings, pkgIdent).(*ast.CallExpr)
+		call.Args = append(call.Args, msgAndArgs...)
+		if ellipsis {
+			// Any non-zero Pos marks Args[len(Args)-1] as "...spread"; the
+			// printer re-derives layout from the AST, not from this position.
+			call.Ellipsis = token.Pos(1)
+		}
+		return call
+	}
+
+	return Rule{
+		Func:    beforeSel.Sel.Name,
+		Aliases: cr.Aliases,
+		NArgs:   len(params),
+		Build:   build,
+		Imports: append(append([]string{}, cr.Imports...), cr.HelperImports...),
+	}, nil
+}
+
+// parseTemplateCall parses a before/after template, which is a single Go
+// call expression with an optional trailing literal ARGS standing in for
+// msgAndArgs (stripped before parsing, since a bare ARGS isn't valid Go).
+func parseTemplateCall(src string) (*ast.CallExpr, error) {
+	src = strings.TrimSpace(strings.Replace(src, "ARGS", "", -1))
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a call expression", src)
+	}
+	return call, nil
+}
+
+// substTemplate deep-copies e, replacing the identifier YY with pkgIdent
+// and every other identifier found in bindings with its bound expression.
+// Only identifiers, selector expressions and call expressions are walked;
+// any other node (a literal, a unary or binary expression, ...) is returned
+// as is, shared with the template, and identifiers inside it are not
+// substituted.
+func substTemplate(e ast.Expr, bindings map[string]ast.Expr, pkgIdent string) ast.Expr {
+	switch x := e.(type) {
+	case *ast.Ident:
+		if x.Name == "YY" {
+			return ast.NewIdent(pkgIdent)
+		}
+		repl, ok := bindings[x.Name]
+		if !ok {
+			return ast.NewIdent(x.Name)
+		}
+		return cloneExpr(repl) // repl may be bound into more than one call site
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: substTemplate(x.X, bindings, pkgIdent), Sel: ast.NewIdent(x.Sel.Name)}
+	case *ast.CallExpr:
+		args := make([]ast.Expr, len(x.Args))
+		for i, a := range x.Args {
+			args[i] = substTemplate(a, bindings, pkgIdent)
+		}
+		return &ast.CallExpr{Fun: substTemplate(x.Fun, bindings, pkgIdent), Args: args}
+	default:
+		return x
+	}
+}
+
+// cloneExpr returns a copy of e sharing no AST nodes with it. A rule's
+// After template may reference the same Before parameter more than once
+// (e.g. "YY.EQ(t, a, a ARGS)"), and splicing the same bound expression
+// into two positions in the output tree corrupts position info and
+// confuses astutil/the printer, which assume a tree, not a DAG. Printing
+// and re-parsing works for any expression, not just the *ast.Ident case a
+// plain identifier substitution can special-case.
+func cloneExpr(e ast.Expr) ast.Expr {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), e); err != nil {
+		// Only reachable if e isn't valid Go, which parseTemplateCall
+		// should already have rejected; fall back to sharing the node
+		// rather than panicking on a rule that otherwise works.
+		return e
+	}
+	clone, err := parser.ParseExpr(buf.String())
+	if err != nil {
+		return e
+	}
+	return clone
+}
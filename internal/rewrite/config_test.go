@@ -0,0 +1,51 @@
+package rewrite
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// TestSubstTemplateCopiesReusedBinding covers a -rules file whose After
+// template references the same Before parameter twice, with a non-Ident
+// argument bound to it. Before the fix, the second occurrence shared the
+// exact same *ast.Expr node as the first, corrupting the output tree.
+func TestSubstTemplateCopiesReusedBinding(t *testing.T) {
+	cr := ConfigRule{
+		Signature: "a interface{}",
+		Before:    "assert.Double(t, a ARGS)",
+		After:     "YY.EQ(t, a, a ARGS)",
+	}
+	rule, err := CompileRule(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argExpr, err := parser.ParseExpr("x.Field()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rule.Build("gexpect", ast.NewIdent("t"), []ast.Expr{argExpr}, nil, false)
+
+	call, ok := got.(*ast.CallExpr)
+	if !ok {
+		t.Fatalf("Build returned %T, want *ast.CallExpr", got)
+	}
+	if len(call.Args) != 3 {
+		t.Fatalf("got %d args, want 3 (t, a, a)", len(call.Args))
+	}
+	if call.Args[1] == call.Args[2] {
+		t.Fatalf("both occurrences of the reused parameter share the same AST node; substTemplate must copy a non-Ident binding, not share it")
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), got); err != nil {
+		t.Fatalf("formatting rewritten call: %v", err)
+	}
+	if want := "gexpect.EQ(t, x.Field(), x.Field())"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,64 @@
+package rewrite
+
+// defaultRulesYAML is the rules file untestify behaves as if it were
+// passed when -rules is not given. Keep this in sync by hand when adding a
+// built-in rule; there is no build step that regenerates it. An entry's
+// "f" variant (e.g. Equalf for Equal) is folded in via aliases rather than
+// a separate entry, since grailbio/testutil's replacement is variadic and
+// the format string simply becomes the leading msgAndArgs element. The
+// Error, Nil and Regexp entries have no alias, so Errorf, Nilf and Regexpf
+// calls are not rewritten.
+const defaultRulesYAML = `
+- signature: "err error"
+  aliases: ["NoErrorf"]
+  before: "assert.NoError(t, err ARGS)"
+  after: "YY.NoError(t, err ARGS)"
+- signature: "err error"
+  before: "assert.Error(t, err ARGS)"
+  after: "YY.NotNil(t, err ARGS)"
+- signature: "err error, a string"
+  aliases: ["EqualErrorf"]
+  before: "assert.EqualError(t, err, a ARGS)"
+  after: "YY.EQ(t, err, a ARGS)"
+- signature: "a interface{}"
+  aliases: ["NotNilf"]
+  before: "assert.NotNil(t, a ARGS)"
+  after: "YY.NotNil(t, a ARGS)"
+- signature: "a interface{}"
+  before: "assert.Nil(t, a ARGS)"
+  after: "YY.Nil(t, a ARGS)"
+- signature: "a, b interface{}"
+  aliases: ["Equalf"]
+  before: "assert.Equal(t, a, b ARGS)"
+  after: "YY.EQ(t, b, a ARGS)"
+- signature: "a, b interface{}"
+  aliases: ["NotEqualf"]
+  before: "assert.NotEqual(t, a, b ARGS)"
+  after: "YY.NEQ(t, b, a ARGS)"
+- signature: "a, b interface{}"
+  before: "assert.Regexp(t, a, b ARGS)"
+  after: "YY.Regexp(t, b, a ARGS)"
+- signature: "a bool"
+  aliases: ["Truef"]
+  before: "assert.True(t, a ARGS)"
+  after: "YY.True(t, a ARGS)"
+- signature: "a bool"
+  aliases: ["Falsef"]
+  before: "assert.False(t, a ARGS)"
+  after: "YY.False(t, a ARGS)"
+- signature: "a, b interface{}"
+  aliases: ["Containsf"]
+  before: "assert.Contains(t, a, b ARGS)"
+  after: "YY.That(t, a, h.Contains(b) ARGS)"
+  helper_imports: ["github.com/grailbio/testutil/h"]
+- signature: "a interface{}"
+  aliases: ["Zerof"]
+  before: "assert.Zero(t, a ARGS)"
+  after: "YY.That(t, a, h.Zero() ARGS)"
+  helper_imports: ["github.com/grailbio/testutil/h"]
+- signature: "a interface{}"
+  aliases: ["NotZerof"]
+  before: "assert.NotZero(t, a ARGS)"
+  after: "YY.That(t, a, h.Not(h.Zero()) ARGS)"
+  helper_imports: ["github.com/grailbio/testutil/h"]
+`
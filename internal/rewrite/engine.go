@@ -0,0 +1,98 @@
+package rewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Rewriter rewrites calls into a single testify package (assert or
+// require) to the corresponding grailbio/testutil package.
+type Rewriter struct {
+	testifyPkgPath string // e.g. assertPkgPath
+	gPkgIdent      string // e.g. "gexpect"
+	gPkgImport     string // e.g. GexpectImport
+	verbose        bool
+
+	rules map[string]Rule // keyed by Rule.Func and by each of Rule.Aliases
+}
+
+// NewAssertRewriter rewrites github.com/stretchr/testify/assert calls to
+// GexpectImport, imported as "gexpect".
+func NewAssertRewriter(rules []Rule, verbose bool) *Rewriter {
+	return newRewriter(assertPkgPath, "gexpect", GexpectImport, rules, verbose)
+}
+
+// NewRequireRewriter rewrites github.com/stretchr/testify/require calls to
+// GassertImport, imported as "gassert".
+func NewRequireRewriter(rules []Rule, verbose bool) *Rewriter {
+	return newRewriter(requirePkgPath, "gassert", GassertImport, rules, verbose)
+}
+
+func newRewriter(testifyPkgPath, gPkgIdent, gPkgImport string, rules []Rule, verbose bool) *Rewriter {
+	return &Rewriter{
+		testifyPkgPath: testifyPkgPath,
+		gPkgIdent:      gPkgIdent,
+		gPkgImport:     gPkgImport,
+		verbose:        verbose,
+		rules:          ruleByFunc(rules),
+	}
+}
+
+// Rewrite walks file, replacing every recognized testify call with its
+// grailbio/testutil equivalent, and reports how many calls it rewrote.
+// info must be the *types.Info populated while type-checking file's
+// package.
+func (r *Rewriter) Rewrite(fset *token.FileSet, info *types.Info, file *ast.File) int {
+	n := 0
+	extraImports := map[string]bool{}
+	astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
+		call, ok := c.Node().(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkgIdent, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pkgName, ok := info.Uses[pkgIdent].(*types.PkgName)
+		if !ok || pkgName.Imported().Path() != r.testifyPkgPath {
+			return true
+		}
+		rule, ok := r.rules[sel.Sel.Name]
+		if !ok {
+			return true
+		}
+		if len(call.Args) < rule.NArgs+1 {
+			return true // malformed call (fewer args than the signature requires); leave it alone
+		}
+		t := call.Args[0]
+		args := call.Args[1 : 1+rule.NArgs]
+		msgAndArgs := call.Args[1+rule.NArgs:]
+		c.Replace(rule.Build(r.gPkgIdent, t, args, msgAndArgs, call.Ellipsis != token.NoPos))
+		n++
+		for _, imp := range rule.Imports {
+			extraImports[imp] = true
+		}
+		if r.verbose {
+			fmt.Fprintf(os.Stderr, "%s: rewrote %s.%s to %s.%s\n",
+				fset.Position(call.Pos()), pkgName.Name(), sel.Sel.Name, r.gPkgIdent, rule.Func)
+		}
+		return true
+	})
+	if n > 0 {
+		astutil.AddNamedImport(fset, file, r.gPkgIdent, r.gPkgImport)
+		for imp := range extraImports {
+			astutil.AddImport(fset, file, imp)
+		}
+	}
+	return n
+}
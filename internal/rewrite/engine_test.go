@@ -0,0 +1,27 @@
+package rewrite
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRewriterForwardsAliasAndEllipsis covers the free-function path (as
+// opposed to the receiver-style or suite-style paths, which have their own
+// tests): an Xxxf alias collapses onto its non-f Rule, and msgAndArgs
+// passed as a spread stays a spread in the rewritten call.
+func TestRewriterForwardsAliasAndEllipsis(t *testing.T) {
+	fset, pkg := loadFixture(t, "engine_free")
+	file := pkg.Syntax[0]
+
+	r := NewAssertRewriter(Rules, false)
+	n := r.Rewrite(fset, pkg.TypesInfo, file)
+	if n != 1 {
+		t.Fatalf("Rewrite rewrote %d calls, want 1", n)
+	}
+
+	got := formatFile(t, fset, file)
+	normalized := strings.Join(strings.Fields(got), " ")
+	if want := `gexpect.EQ(t, 2, 1, "mismatch %d", args...)`; !strings.Contains(normalized, want) {
+		t.Errorf("output missing %q; got:\n%s", want, got)
+	}
+}
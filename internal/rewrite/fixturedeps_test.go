@@ -0,0 +1,10 @@
+package rewrite
+
+// github.com/stretchr/testify is never imported by this package's own
+// code; it's only imported by the fixtures under testdata/, which
+// packages.Load loads by path at test time rather than through a Go
+// import edge `go mod tidy` can see. Blank-importing one of its packages
+// here anchors the module in go.mod/go.sum so `go mod tidy` doesn't prune
+// it out from under the tests; suite, the testdata fixtures' other
+// testify import, comes from the same module version.
+import _ "github.com/stretchr/testify/assert"
@@ -0,0 +1,181 @@
+package rewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// receiverTarget records what a local assigned from assert.New(t) or
+// require.New(t) should be rewritten against: the free-function package
+// its methods translate to, and the testing.TB expression to pass as
+// those functions' first argument.
+type receiverTarget struct {
+	gPkgIdent string // "gexpect" or "gassert"
+	gImport   string // GexpectImport or GassertImport
+	t         *ast.Ident
+}
+
+// RewriteReceivers finds locals initialized with assert.New(t) or
+// require.New(t), rewrites every method call on them (e.g. a.Equal(x, y),
+// a.Equalf(x, y, f)) to the equivalent Rules entry, and deletes the local's
+// declaration if every use of it was rewritten. It reports how many calls
+// it rewrote.
+//
+// Only a bare identifier (the common case, `t` from the enclosing
+// func(t *testing.T)) is supported as the New(...) argument; locals
+// constructed from a more complex expression are left untouched, since
+// that expression generally isn't safe to duplicate at every call site.
+func RewriteReceivers(fset *token.FileSet, info *types.Info, file *ast.File, rules []Rule, verbose bool) int {
+	targets := map[types.Object]*receiverTarget{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			return true
+		}
+		lhs, ok := assign.Lhs[0].(*ast.Ident)
+		if !ok {
+			return true
+		}
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "New" || len(call.Args) != 1 {
+			return true
+		}
+		t, ok := call.Args[0].(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pkgIdent, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pkgName, ok := info.Uses[pkgIdent].(*types.PkgName)
+		if !ok {
+			return true
+		}
+		var target receiverTarget
+		switch pkgName.Imported().Path() {
+		case assertPkgPath:
+			target = receiverTarget{gPkgIdent: "gexpect", gImport: GexpectImport, t: t}
+		case requirePkgPath:
+			target = receiverTarget{gPkgIdent: "gassert", gImport: GassertImport, t: t}
+		default:
+			return true
+		}
+		obj := info.Defs[lhs]
+		if obj == nil {
+			obj = info.Uses[lhs]
+		}
+		if obj == nil {
+			return true
+		}
+		targets[obj] = &target
+		return true
+	})
+	if len(targets) == 0 {
+		return 0
+	}
+
+	byFunc := ruleByFunc(rules)
+
+	n := 0
+	extraImports := map[string]bool{}
+
+	astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
+		call, ok := c.Node().(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		recvIdent, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		target, ok := targets[info.Uses[recvIdent]]
+		if !ok {
+			return true
+		}
+		rule, ok := byFunc[sel.Sel.Name]
+		if !ok || len(call.Args) < rule.NArgs {
+			return true // a call we don't know how to translate; leave it referencing the local
+		}
+		args := call.Args[:rule.NArgs]
+		msgAndArgs := call.Args[rule.NArgs:]
+		c.Replace(rule.Build(target.gPkgIdent, ast.NewIdent(target.t.Name), args, msgAndArgs, call.Ellipsis != token.NoPos))
+		n++
+		extraImports[target.gImport] = true
+		for _, imp := range rule.Imports {
+			extraImports[imp] = true
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "%s: rewrote %s.%s to %s.%s\n",
+				fset.Position(call.Pos()), recvIdent.Name, sel.Sel.Name, target.gPkgIdent, rule.Func)
+		}
+		return true
+	})
+	if n == 0 {
+		return 0
+	}
+
+	// A local is only safe to delete if nothing in the file still
+	// references it: not just "every method call we recognized got
+	// rewritten", but any remaining *ast.Ident use at all, since the local
+	// may also have been passed to a function, returned, or stored
+	// somewhere the method-call scan above never looked.
+	stillUsed := map[types.Object]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if obj := info.Uses[ident]; targets[obj] != nil {
+			stillUsed[obj] = true
+		}
+		return true
+	})
+
+	// Drop the `x := assert.New(t)` declaration for every local all of
+	// whose uses got rewritten above.
+	astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
+		assign, ok := c.Node().(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != 1 {
+			return true
+		}
+		lhs, ok := assign.Lhs[0].(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := info.Defs[lhs]
+		if obj == nil {
+			obj = info.Uses[lhs]
+		}
+		if _, ok := targets[obj]; !ok || stillUsed[obj] {
+			return true
+		}
+		c.Delete()
+		return true
+	})
+
+	for imp := range extraImports {
+		switch imp {
+		case GexpectImport:
+			astutil.AddNamedImport(fset, file, "gexpect", imp)
+		case GassertImport:
+			astutil.AddNamedImport(fset, file, "gassert", imp)
+		default:
+			astutil.AddImport(fset, file, imp)
+		}
+	}
+	return n
+}
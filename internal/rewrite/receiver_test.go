@@ -0,0 +1,111 @@
+package rewrite
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadFixture type-checks the single-file package under
+// testdata/<dir> and returns its fset and package; the package's sole
+// syntax tree is pkg.Syntax[0].
+func loadFixture(t *testing.T, dir string) (*token.FileSet, *packages.Package) {
+	t.Helper()
+	fset := token.NewFileSet()
+	cfg := &packages.Config{
+		Dir: "testdata/" + dir,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo | packages.NeedDeps | packages.NeedImports,
+		Fset: fset,
+	}
+	pkgs, err := packages.Load(cfg, ".")
+	if err != nil {
+		t.Fatalf("packages.Load(%s): %v", dir, err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatalf("testdata/%s has load errors", dir)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].Syntax) != 1 {
+		t.Fatalf("testdata/%s: got %d packages, want 1 package with 1 file", dir, len(pkgs))
+	}
+	return fset, pkgs[0]
+}
+
+func formatFile(t *testing.T, fset *token.FileSet, file *ast.File) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		t.Fatalf("format.Node: %v", err)
+	}
+	return buf.String()
+}
+
+func TestRewriteReceivers(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		dir         string
+		wantContain []string
+		wantAbsent  []string
+	}{
+		{
+			// All of a's method calls are rewritten, so the `a :=
+			// assert.New(t)` declaration should be dropped.
+			name: "all calls rewritten, decl deleted",
+			dir:  "receiver_all",
+			wantContain: []string{
+				"gexpect.EQ(t, 2, 1)",
+				"gexpect.True(t, true)",
+			},
+			wantAbsent: []string{
+				"assert.New(t)",
+			},
+		},
+		{
+			// a.InDelta has no Rule, so a is still referenced after the
+			// rewrite and its declaration must survive.
+			name: "one unmapped method left, decl kept",
+			dir:  "receiver_partial",
+			wantContain: []string{
+				"a := assert.New(t)",
+				"gexpect.EQ(t, 2, 1)",
+				"a.InDelta(",
+			},
+		},
+		{
+			// Every method call on a got rewritten, but a is also passed
+			// to helper(), so its declaration must survive.
+			name: "local passed to another function, decl kept",
+			dir:  "receiver_escapes",
+			wantContain: []string{
+				"a := assert.New(t)",
+				"gexpect.EQ(t, 2, 1)",
+				"helper(a)",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fset, pkg := loadFixture(t, tc.dir)
+			file := pkg.Syntax[0]
+			n := RewriteReceivers(fset, pkg.TypesInfo, file, Rules, false)
+			if n == 0 {
+				t.Fatalf("RewriteReceivers rewrote nothing")
+			}
+			got := formatFile(t, fset, file)
+			for _, want := range tc.wantContain {
+				if !strings.Contains(got, want) {
+					t.Errorf("output missing %q; got:\n%s", want, got)
+				}
+			}
+			for _, absent := range tc.wantAbsent {
+				if strings.Contains(got, absent) {
+					t.Errorf("output unexpectedly contains %q; got:\n%s", absent, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Package rewrite is an in-tree replacement for the eg-based rewriter that
+// untestify used to drive golang.org/x/tools/refactor/eg. It walks the
+// type-checked AST of a loaded package, recognizes calls into
+// github.com/stretchr/testify/{assert,require}, and synthesizes the
+// equivalent github.com/grailbio/testutil/{expect,assert} call in place.
+//
+// Unlike eg, this package never needs the replacement expression to be
+// assignable to the pattern expression (eg's template-matching trick), so
+// none of the callers of this package require patching eg's assignability
+// check.
+package rewrite
+
+const (
+	assertPkgPath  = "github.com/stretchr/testify/assert"
+	requirePkgPath = "github.com/stretchr/testify/require"
+
+	// GexpectImport and GassertImport are the grailbio/testutil packages
+	// that replace testify/assert and testify/require, respectively.
+	GexpectImport = "github.com/grailbio/testutil/expect"
+	GassertImport = "github.com/grailbio/testutil/assert"
+	// HImport is the matcher package referenced by rules whose Imports
+	// field includes it (e.g. Contains, Zero).
+	HImport = "github.com/grailbio/testutil/h"
+)
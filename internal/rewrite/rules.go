@@ -0,0 +1,58 @@
+package rewrite
+
+import "go/ast"
+
+// Rule describes how one testify assertion function is translated into the
+// equivalent grailbio/testutil call. The leading *testing.T (or testify's
+// TestingT) argument and the trailing msgAndArgs ...interface{} are handled
+// by the engine; Build only needs to place the NArgs fixed arguments.
+type Rule struct {
+	// Func is the unqualified testify function name, e.g. "Equal".
+	Func string
+	// Aliases are additional testify function names this rule also
+	// applies to, e.g. "Equalf" for the Func "Equal". Since
+	// grailbio/testutil's replacement call is variadic, an alias needs
+	// no Build logic of its own: its format-string argument simply ends
+	// up as the first element of msgAndArgs.
+	Aliases []string
+	// NArgs is the number of fixed arguments the function takes, not
+	// counting the leading t and the trailing msgAndArgs.
+	NArgs int
+	// Build returns the replacement call. pkgIdent is "gexpect" or
+	// "gassert" depending on which testify package matched. args holds
+	// the NArgs fixed arguments in testify's declared order. msgAndArgs
+	// and ellipsis are the original call's trailing varargs, forwarded
+	// verbatim.
+	Build func(pkgIdent string, t ast.Expr, args, msgAndArgs []ast.Expr, ellipsis bool) ast.Expr
+	// Imports lists additional import paths Build's output may
+	// reference, beyond the gexpect/gassert package itself.
+	Imports []string
+}
+
+// Rules is the testify -> grailbio/testutil rule table the engine applies
+// when no -rules file is given (see CompileRules for user-supplied rules).
+// It's compiled from defaultRulesYAML via the same ConfigRule machinery a
+// -rules file goes through, so both paths behave identically.
+var Rules = mustCompileDefaultRules()
+
+func mustCompileDefaultRules() []Rule {
+	rules, err := DefaultRules()
+	if err != nil {
+		panic("rewrite: built-in default rules failed to compile: " + err.Error())
+	}
+	return rules
+}
+
+// ruleByFunc indexes rules by testify function name, including aliases, so
+// a caller can look up e.g. both "Equal" and "Equalf" and land on the same
+// Rule.
+func ruleByFunc(rules []Rule) map[string]Rule {
+	m := make(map[string]Rule, len(rules))
+	for _, rule := range rules {
+		m[rule.Func] = rule
+		for _, alias := range rule.Aliases {
+			m[alias] = rule
+		}
+	}
+	return m
+}
@@ -0,0 +1,134 @@
+package rewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const suitePkgPath = "github.com/stretchr/testify/suite"
+
+// RewriteSuite rewrites stretchr/testify/suite-based assertions -
+// s.Equal(a, b), s.Require().NoError(err), s.Assert().True(ok), and so on -
+// to the equivalent Rules entry, passing s.T() as the testing.TB argument.
+// SetupTest/TearDownTest and other suite lifecycle methods are left alone
+// except for their call sites, which are rewritten exactly like any other
+// method body. It reports how many calls it rewrote. With verbose set, it
+// prints a diagnostic to stderr for every suite assertion call it
+// recognizes, whether or not a rule translates that call.
+func RewriteSuite(fset *token.FileSet, info *types.Info, file *ast.File, rules []Rule, verbose bool) int {
+	byFunc := ruleByFunc(rules)
+
+	n := 0
+	extraImports := map[string]bool{}
+	astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
+		call, ok := c.Node().(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		recv, gPkgIdent, ok := suiteReceiver(info, sel)
+		if !ok {
+			return true
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "%s: found suite assertion %s.%s\n", fset.Position(call.Pos()), recv, sel.Sel.Name)
+		}
+		rule, ok := byFunc[sel.Sel.Name]
+		if !ok || len(call.Args) < rule.NArgs {
+			return true
+		}
+		args := call.Args[:rule.NArgs]
+		msgAndArgs := call.Args[rule.NArgs:]
+		t := &ast.CallExpr{Fun: &ast.SelectorExpr{X: ast.NewIdent(recv), Sel: ast.NewIdent("T")}}
+		c.Replace(rule.Build(gPkgIdent, t, args, msgAndArgs, call.Ellipsis != token.NoPos))
+		n++
+		if gPkgIdent == "gexpect" {
+			extraImports[GexpectImport] = true
+		} else {
+			extraImports[GassertImport] = true
+		}
+		for _, imp := range rule.Imports {
+			extraImports[imp] = true
+		}
+		return true
+	})
+	for imp := range extraImports {
+		switch imp {
+		case GexpectImport:
+			astutil.AddNamedImport(fset, file, "gexpect", imp)
+		case GassertImport:
+			astutil.AddNamedImport(fset, file, "gassert", imp)
+		default:
+			astutil.AddImport(fset, file, imp)
+		}
+	}
+	return n
+}
+
+// suiteReceiver reports whether sel is a testify suite assertion call -
+// s.Equal(...) (promoted from the suite's embedded *assert.Assertions or
+// *require.Assertions) or s.Require().Xxx(...)/s.Assert().Xxx(...) - and if
+// so, the receiver's identifier name and which grailbio/testutil package
+// its method maps to.
+func suiteReceiver(info *types.Info, sel *ast.SelectorExpr) (recv, gPkgIdent string, ok bool) {
+	switch x := sel.X.(type) {
+	case *ast.Ident:
+		// s.Equal(...): Equal is promoted from the suite's embedded
+		// *assert.Assertions (or *require.Assertions). A method called
+		// directly on an *assert.Assertions value (a := assert.New(t)) is
+		// not promoted and is not a suite assertion.
+		if selection, ok := info.Selections[sel]; !ok || len(selection.Index()) < 2 {
+			return "", "", false
+		}
+		fn, ok := funcFromSelection(info, sel)
+		if !ok || fn.Pkg() == nil {
+			return "", "", false
+		}
+		switch fn.Pkg().Path() {
+		case assertPkgPath:
+			return x.Name, "gexpect", true
+		case requirePkgPath:
+			return x.Name, "gassert", true
+		}
+		return "", "", false
+
+	case *ast.CallExpr:
+		// s.Require().Xxx(...) or s.Assert().Xxx(...).
+		inner, ok := x.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return "", "", false
+		}
+		recvIdent, ok := inner.X.(*ast.Ident)
+		if !ok {
+			return "", "", false
+		}
+		fn, ok := funcFromSelection(info, inner)
+		if !ok || fn.Pkg() == nil || fn.Pkg().Path() != suitePkgPath {
+			return "", "", false
+		}
+		switch inner.Sel.Name {
+		case "Require":
+			return recvIdent.Name, "gassert", true
+		case "Assert":
+			return recvIdent.Name, "gexpect", true
+		}
+	}
+	return "", "", false
+}
+
+func funcFromSelection(info *types.Info, sel *ast.SelectorExpr) (*types.Func, bool) {
+	selection, ok := info.Selections[sel]
+	if !ok {
+		return nil, false
+	}
+	fn, ok := selection.Obj().(*types.Func)
+	return fn, ok
+}
@@ -0,0 +1,60 @@
+package rewrite
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRewriteSuite(t *testing.T) {
+	fset, pkg := loadFixture(t, "suite")
+	file := pkg.Syntax[0]
+	n := RewriteSuite(fset, pkg.TypesInfo, file, Rules, false)
+	if n != 3 {
+		t.Fatalf("RewriteSuite rewrote %d calls, want 3", n)
+	}
+	got := formatFile(t, fset, file)
+	for _, want := range []string{
+		// s.Equal(1, 2): promoted from the embedded *assert.Assertions.
+		"gexpect.EQ(s.T(), 2, 1)",
+		// s.Require().NoError(nil): routes to the gassert package.
+		"gassert.NoError(s.T(), nil)",
+		// s.Assert().True(true): routes to the gexpect package.
+		"gexpect.True(s.T(), true)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q; got:\n%s", want, got)
+		}
+	}
+}
+
+// TestRewriteSuiteVerbose confirms the -v diagnostic fires once per
+// recognized suite assertion, as RewriteSuite's doc comment describes.
+func TestRewriteSuiteVerbose(t *testing.T) {
+	fset, pkg := loadFixture(t, "suite")
+	file := pkg.Syntax[0]
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	RewriteSuite(fset, pkg.TypesInfo, file, Rules, true)
+	w.Close()
+	os.Stderr = stderr
+
+	buf := make([]byte, 4096)
+	n, _ := r.Read(buf)
+	got := string(buf[:n])
+
+	for _, want := range []string{
+		"found suite assertion s.Equal",
+		"found suite assertion s.NoError",
+		"found suite assertion s.True",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("-v output missing %q; got:\n%s", want, got)
+		}
+	}
+}
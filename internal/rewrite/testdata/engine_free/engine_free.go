@@ -0,0 +1,14 @@
+// Package enginefree is a Rewriter fixture exercising a free-function
+// testify call through its Xxxf alias, with the trailing msgAndArgs
+// forwarded via a spread.
+package enginefree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func F(t *testing.T, args ...interface{}) {
+	assert.Equalf(t, 1, 2, "mismatch %d", args...)
+}
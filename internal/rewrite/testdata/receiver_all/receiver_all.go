@@ -0,0 +1,16 @@
+// Package receiverall is a RewriteReceivers fixture where every call on the
+// receiver-style local is rewritten, so the local's declaration should be
+// deleted.
+package receiverall
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func F(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(1, 2)
+	a.True(true)
+}
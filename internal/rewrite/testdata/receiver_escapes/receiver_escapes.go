@@ -0,0 +1,19 @@
+// Package receiverescapes is a RewriteReceivers fixture where the
+// receiver-style local is passed to another function after its only
+// translatable call, so the local's declaration must be kept even though
+// every call site got rewritten.
+package receiverescapes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func helper(a *assert.Assertions) {}
+
+func F(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(1, 2)
+	helper(a)
+}
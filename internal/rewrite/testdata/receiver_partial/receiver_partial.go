@@ -0,0 +1,16 @@
+// Package receiverpartial is a RewriteReceivers fixture where one call on
+// the receiver-style local (InDelta, which has no Rule) is left
+// untranslated, so the local's declaration must be kept.
+package receiverpartial
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func F(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(1, 2)
+	a.InDelta(1.0, 1.1, 0.2)
+}
@@ -0,0 +1,24 @@
+// Package suitefixture is a RewriteSuite fixture exercising all three
+// shapes RewriteSuite recognizes: a promoted assert method, s.Require(),
+// and s.Assert().
+package suitefixture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type S struct {
+	suite.Suite
+}
+
+func (s *S) TestAll() {
+	s.Equal(1, 2)
+	s.Require().NoError(nil)
+	s.Assert().True(true)
+}
+
+func TestSuite(t *testing.T) {
+	suite.Run(t, new(S))
+}
@@ -1,27 +1,36 @@
-// To use this tool, you must modify golang.org/x/tools/refactor/eg/eg.go and comment out line 233:
+// By default this tool rewrites testify calls using the native engine in
+// internal/rewrite, which needs no changes to golang.org/x/tools. Passing
+// -engine=eg falls back to the original golang.org/x/tools/refactor/eg
+// based engine, kept only so in-flight -engine=eg users have a transition
+// window; it is slated for deletion (along with runEg, addTemplates and
+// substitutions below) once that window closes, and only this deprecated
+// path requires the eg patch described below - the default native engine
+// needs none of it. To use -engine=eg you must modify
+// golang.org/x/tools/refactor/eg/eg.go and comment out line 233:
 //
-// if types.AssignableTo(Tb, Ta) {
-// 	// safe: replacement is assignable to pattern.
-// } else if tuple, ok := Tb.(*types.Tuple); ok && tuple.Len() == 0 {
-// 	// safe: pattern has void type (must appear in an ExprStmt).
-// } else {
-// 	return nil, fmt.Errorf("%s is not a safe replacement for %s", Ta, Tb)  <<<< comment out this line
-// }
+//	if types.AssignableTo(Tb, Ta) {
+//		// safe: replacement is assignable to pattern.
+//	} else if tuple, ok := Tb.(*types.Tuple); ok && tuple.Len() == 0 {
 //
+//		// safe: pattern has void type (must appear in an ExprStmt).
+//	} else {
+//
+//		return nil, fmt.Errorf("%s is not a safe replacement for %s", Ta, Tb)  <<<< comment out this line
+//	}
 package main
 
 import (
 	"flag"
 	"fmt"
-	"go/build"
+	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"os"
 
 	"github.com/grailbio/base/log"
-	"go/ast"
-	"golang.org/x/tools/go/buildutil"
-	"golang.org/x/tools/go/loader"
+	"github.com/yasushi-saito/untestify/internal/rewrite"
+	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/refactor/eg"
 	"io/ioutil"
 	"path/filepath"
@@ -31,19 +40,27 @@ import (
 var (
 	helpFlag    = flag.Bool("help", false, "show detailed help message")
 	verboseFlag = flag.Bool("v", false, "show verbose matcher diagnostics")
+	engineFlag  = flag.String("engine", "native", `rewrite engine to use: "native" (go/ast+go/types, no eg patch required) or "eg" (legacy, requires a patched golang.org/x/tools/refactor/eg)`)
+	tagsFlag    = flag.String("tags", "", "comma-separated list of build tags to apply when loading packages")
+	rulesFlag   = flag.String("rules", "", "path to a YAML rules file (schema: internal/rewrite.ConfigRule); defaults to the built-in testify rule set")
+	onlyFlag    = flag.String("only", "", "comma-separated list of rule Func names to apply, e.g. Equal,NoError; defaults to all rules")
 )
 
-func init() {
-	flag.Var((*buildutil.TagsFlag)(&build.Default.BuildTags), "tags", buildutil.TagsFlagDoc)
-}
-
 const usage = `untestify: convert stretcher/testify to grailbio.com/testutil.
 
 Usage: untestify [flags] packages...
 
 -help            show detailed help message
 -v               show verbose matcher diagnostics
-` + loader.FromArgsUsage
+-engine          "native" (default) or "eg"
+-tags            comma-separated build tags
+-rules           path to a YAML rules file; defaults to the built-in set
+-only            comma-separated rule Func names to restrict rewriting to
+
+packages is one or more package patterns as understood by
+golang.org/x/tools/go/packages, e.g. ./... or a module import path. Both
+GOPATH and module-mode repos are supported.
+`
 
 type substitution struct {
 	signature, beforeBody, afterBody string
@@ -69,9 +86,9 @@ var substitutions = []substitution{
 	{"t TT, a, b interface{} DECLS", "XX.Contains(t, a, b ARGS)", "YY.That(t, a, h.Contains(b) ARGS)"},
 	{"t TT, a, b interface{}, f string DECLS", "XX.Containsf(t, a, b, f ARGS)", "YY.That(t, a, h.Contains(b), f ARGS)"},
 	{"t TT, a interface{} DECLS", "XX.Zero(t, a ARGS)", "YY.That(t, a, h.Zero() ARGS)"},
-	{"t TT, a interface{}, f string DECLS", "XX.Zerof(t, a, f ARGS)", "YY.EQ(t, a, h.Zero(), f ARGS)"},
+	{"t TT, a interface{}, f string DECLS", "XX.Zerof(t, a, f ARGS)", "YY.That(t, a, h.Zero(), f ARGS)"},
 	{"t TT, a interface{} DECLS", "XX.NotZero(t, a ARGS)", "YY.That(t, a, h.Not(h.Zero()) ARGS)"},
-	{"t TT, a interface{}, f string DECLS", "XX.NotZerof(t, a, f ARGS)", "YY.EQ(t, a, h.Not(h.Zero()), f ARGS)"},
+	{"t TT, a interface{}, f string DECLS", "XX.NotZerof(t, a, f ARGS)", "YY.That(t, a, h.Not(h.Zero()), f ARGS)"},
 }
 
 var templateSeq = 0
@@ -83,11 +100,19 @@ const (
 	rewriteAssert
 )
 
-func addTemplates(conf *loader.Config, rType rewriteType, subs []substitution) int {
+// addTemplates writes one eg template file per (sub, arg-count) pair to
+// disk and loads each of them as its own ad hoc package via cfg, returning
+// them in the order the templates were generated: six per sub, one for
+// each count of trailing message arguments from zero to five. It no longer
+// assumes testify is vendored
+// under vendor/ - cfg (and whatever build system backs packages.Load)
+// resolves github.com/stretchr/testify/{assert,require} the same way it
+// would resolve any other import, vendored or not.
+func addTemplates(cfg *packages.Config, rType rewriteType, subs []substitution) []*packages.Package {
 	const dir = "/tmp/.templatestmp"
 	os.Mkdir(dir, 0700) // nolint: errcheck
 
-	n := 0
+	var paths []string
 	for _, sub := range subs {
 		var before, after, imports string
 		switch rType {
@@ -95,14 +120,14 @@ func addTemplates(conf *loader.Config, rType rewriteType, subs []substitution) i
 			before = strings.Replace(sub.beforeBody, "XX", "assert", -1)
 			after = strings.Replace(sub.afterBody, "YY", "gexpect", -1)
 			imports = `
- "vendor/github.com/stretchr/testify/assert"
+ "github.com/stretchr/testify/assert"
 gexpect "github.com/grailbio/testutil/expect"
 `
 		case rewriteRequire:
 			before = strings.Replace(sub.beforeBody, "XX", "require", -1)
 			after = strings.Replace(sub.afterBody, "YY", "gassert", -1)
 			imports = `
- "vendor/github.com/stretchr/testify/require"
+ "github.com/stretchr/testify/require"
 gassert "github.com/grailbio/testutil/assert"
 `
 		}
@@ -144,21 +169,63 @@ func after(%s) { %s }
 			if err := ioutil.WriteFile(path, []byte(body), 0600); err != nil {
 				log.Panic(err)
 			}
-			conf.CreateFromFilenames(pkgName, path)
-			n++
+			paths = append(paths, path)
 		}
 	}
-	return n
+
+	pkgs := make([]*packages.Package, 0, len(paths))
+	for _, path := range paths {
+		loaded, err := packages.Load(cfg, "file="+path)
+		if err != nil {
+			log.Panic(err)
+		}
+		if len(loaded) != 1 {
+			log.Panicf("file=%s: got %d packages, want 1", path, len(loaded))
+		}
+		pkgs = append(pkgs, loaded[0])
+	}
+	return pkgs
+}
+
+// testifyImportPath reports whether path is exactly the testify assert or
+// require package (not merely a substring match, which could also hit an
+// unrelated package that happens to embed "/testify/assert" in its path).
+func testifyImportPath(path string) bool {
+	return path == `"github.com/stretchr/testify/assert"` || path == `"github.com/stretchr/testify/require"`
+}
+
+// testifyImportStillUsed reports whether any SelectorExpr remaining in
+// file still selects off the testify package imported at path (e.g. an
+// assert.NoError call left behind by -only while assert.Equal in the same
+// file got rewritten). Imports with remaining uses must not be deleted.
+func testifyImportStillUsed(info *types.Info, file *ast.File, path string) bool {
+	used := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if used {
+			return false
+		}
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pkgName, ok := info.Uses[ident].(*types.PkgName)
+		if ok && pkgName.Imported().Path() == path {
+			used = true
+		}
+		return true
+	})
+	return used
 }
 
-func rewriteImports(file *ast.File) int {
+func rewriteImports(info *types.Info, file *ast.File) int {
 	n := 0
 	j := 0
 	for _, imp := range file.Imports {
-		if strings.Contains(imp.Path.Value, "/testify/require") {
-			continue
-		}
-		if strings.Contains(imp.Path.Value, "/testify/assert") {
+		if testifyImportPath(imp.Path.Value) && !testifyImportStillUsed(info, file, strings.Trim(imp.Path.Value, `"`)) {
 			continue
 		}
 		file.Imports[j] = imp
@@ -175,18 +242,15 @@ func rewriteImports(file *ast.File) int {
 			j = 0
 			for _, x := range d.Specs {
 				imp := x.(*ast.ImportSpec)
-				if strings.Index(imp.Path.Value, "/testify/require") >= 0 {
-					continue
-				}
-				if strings.Index(imp.Path.Value, "/testify/assert") >= 0 {
+				if testifyImportPath(imp.Path.Value) && !testifyImportStillUsed(info, file, strings.Trim(imp.Path.Value, `"`)) {
 					continue
 				}
-				if strings.Index(imp.Path.Value, "github.com/grailbio/testutil/expect") >= 0 {
+				if imp.Path.Value == `"`+rewrite.GexpectImport+`"` {
 					tmp := ast.Ident{}
 					tmp.Name = "gexpect"
 					imp.Name = &tmp
 				}
-				if strings.Index(imp.Path.Value, "github.com/grailbio/testutil/assert") >= 0 {
+				if imp.Path.Value == `"`+rewrite.GassertImport+`"` {
 					tmp := ast.Ident{}
 					tmp.Name = "gassert"
 					imp.Name = &tmp
@@ -217,50 +281,136 @@ func main() {
 		os.Exit(1)
 	}
 
-	conf := loader.Config{
-		Fset:       token.NewFileSet(),
-		ParserMode: parser.ParseComments,
+	fset := token.NewFileSet()
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo | packages.NeedDeps | packages.NeedImports,
+		Fset:  fset,
+		Tests: true,
+		ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			return parser.ParseFile(fset, filename, src, parser.ParseComments)
+		},
+		BuildFlags: buildFlags(),
 	}
 
-	nTemplate := addTemplates(&conf, rewriteRequire, substitutions)
-	nTemplate += addTemplates(&conf, rewriteAssert, substitutions)
-	_, err := conf.FromArgs(args, true)
-	if err != nil {
-		log.Panic(err)
+	var templates []*packages.Package
+	if *engineFlag == "eg" {
+		templates = addTemplates(cfg, rewriteRequire, substitutions)
+		templates = append(templates, addTemplates(cfg, rewriteAssert, substitutions)...)
 	}
 
-	iprog, err := conf.Load()
+	pkgs, err := packages.Load(cfg, args...)
 	if err != nil {
 		log.Panic(err)
 	}
+	if packages.PrintErrors(pkgs) > 0 {
+		os.Exit(1)
+	}
 
+	switch *engineFlag {
+	case "native":
+		runNative(fset, pkgs, loadRules())
+	case "eg":
+		runEg(fset, pkgs, templates)
+	default:
+		log.Panicf("unknown -engine %q: want \"native\" or \"eg\"", *engineFlag)
+	}
+}
+
+// buildFlags turns -tags into the -tags=... argument packages.Load's
+// underlying go list invocation expects.
+func buildFlags() []string {
+	if *tagsFlag == "" {
+		return nil
+	}
+	return []string{"-tags=" + *tagsFlag}
+}
+
+// loadRules resolves -rules and -only into the Rule table runNative should
+// apply: the built-in set unless -rules names a file, filtered down to
+// -only's Func names if given.
+func loadRules() []rewrite.Rule {
+	rules := rewrite.Rules
+	if *rulesFlag != "" {
+		crs, err := rewrite.LoadRulesFile(*rulesFlag)
+		if err != nil {
+			log.Panic(err)
+		}
+		rules, err = rewrite.CompileRules(crs)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	if *onlyFlag == "" {
+		return rules
+	}
+	only := map[string]bool{}
+	for _, name := range strings.Split(*onlyFlag, ",") {
+		only[strings.TrimSpace(name)] = true
+	}
+	filtered := rules[:0:0]
+	for _, rule := range rules {
+		if only[rule.Func] {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered
+}
+
+// runNative rewrites every loaded package using the in-tree rewrite
+// package, which needs no eg patch.
+func runNative(fset *token.FileSet, pkgs []*packages.Package, rules []rewrite.Rule) {
+	assertRewriter := rewrite.NewAssertRewriter(rules, *verboseFlag)
+	requireRewriter := rewrite.NewRequireRewriter(rules, *verboseFlag)
+
+	for _, pkg := range pkgs {
+		fmt.Fprintf(os.Stderr, "=== Package %s (%d files)\n", pkg.PkgPath, len(pkg.Syntax))
+		for _, file := range pkg.Syntax {
+			n := assertRewriter.Rewrite(fset, pkg.TypesInfo, file)
+			n += requireRewriter.Rewrite(fset, pkg.TypesInfo, file)
+			n += rewrite.RewriteReceivers(fset, pkg.TypesInfo, file, rules, *verboseFlag)
+			n += rewrite.RewriteSuite(fset, pkg.TypesInfo, file, rules, *verboseFlag)
+			n += rewriteImports(pkg.TypesInfo, file)
+			if n == 0 {
+				continue
+			}
+			filename := fset.File(file.Pos()).Name()
+			fmt.Fprintf(os.Stderr, "=== %s (%d matches)\n", filename, n)
+			if err := eg.WriteAST(fset, filename, file); err != nil {
+				log.Panic(err)
+			}
+		}
+	}
+}
+
+// runEg rewrites every loaded package using golang.org/x/tools/refactor/eg
+// against the templates addTemplates generated. This path is kept during
+// the transition to the native engine and requires the patched eg
+// described at the top of this file.
+func runEg(fset *token.FileSet, pkgs, templates []*packages.Package) {
 	xforms := []*eg.Transformer{}
-	for i := 0; i < nTemplate; i++ {
-		template := iprog.Created[i]
-		xform, err := eg.NewTransformer(iprog.Fset, template.Pkg, template.Files[0], &template.Info, *verboseFlag)
+	for _, template := range templates {
+		xform, err := eg.NewTransformer(fset, template.Types, template.Syntax[0], template.TypesInfo, *verboseFlag)
 		if err != nil {
 			log.Panic(err)
 		}
 		xforms = append(xforms, xform)
 	}
 
-	for _, pkg := range iprog.InitialPackages() {
-		if strings.Contains(pkg.String(), "template000") {
-			continue
-		}
-		fmt.Fprintf(os.Stderr, "=== Package %s (%d files)\n", pkg.String(), len(pkg.Files))
-		for _, file := range pkg.Files {
+	for _, pkg := range pkgs {
+		fmt.Fprintf(os.Stderr, "=== Package %s (%d files)\n", pkg.PkgPath, len(pkg.Syntax))
+		for _, file := range pkg.Syntax {
 			n := 0
 			for _, xform := range xforms {
-				n += xform.Transform(&pkg.Info, pkg.Pkg, file)
+				n += xform.Transform(pkg.TypesInfo, pkg.Types, file)
 			}
-			n += rewriteImports(file)
+			n += rewriteImports(pkg.TypesInfo, file)
 			if n == 0 {
 				continue
 			}
-			filename := iprog.Fset.File(file.Pos()).Name()
+			filename := fset.File(file.Pos()).Name()
 			fmt.Fprintf(os.Stderr, "=== %s (%d matches)\n", filename, n)
-			if err := eg.WriteAST(iprog.Fset, filename, file); err != nil {
+			if err := eg.WriteAST(fset, filename, file); err != nil {
 				log.Panic(err)
 			}
 		}